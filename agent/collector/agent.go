@@ -0,0 +1,38 @@
+package collector
+
+import (
+	"bytes"
+	"io"
+)
+
+// SSHCollectingAgent is the remote host connection every collection mode in
+// this package drives: snapshotting shells out over it, the upload sinks
+// pipe manifests through it, and remote-read streams the read response back
+// through it. It is declared here, alongside its callers, so this package
+// compiles against a known, complete contract rather than one defined (and
+// possibly extended) elsewhere.
+type SSHCollectingAgent interface {
+	// Connect establishes the session used by every other method below.
+	Connect() error
+
+	// GetHost identifies the agent for logging.
+	GetHost() string
+
+	// ExecuteCommand runs command on the remote host and returns its
+	// stdout/stderr in full once it completes.
+	ExecuteCommand(command string) (sout *bytes.Buffer, serr *bytes.Buffer, err error)
+
+	// ExecuteCommandWithInput is ExecuteCommand, but pipes input to the
+	// command's stdin - for commands like "cat >" that read their payload
+	// instead of taking it as an argument.
+	ExecuteCommandWithInput(command string, input []byte) (sout *bytes.Buffer, serr *bytes.Buffer, err error)
+
+	// ExecuteCommandStreaming is ExecuteCommandWithInput, except stdout is
+	// handed back as a stream instead of being buffered in full, for
+	// commands whose output is too large to hold in memory at once.
+	ExecuteCommandStreaming(command string, input []byte) (stdout io.ReadCloser, serr *bytes.Buffer, err error)
+
+	// ReceiveDir downloads src from the remote host into dest, running every
+	// file through decompress first if it is non-nil.
+	ReceiveDir(src string, dest string, decompress func(io.Reader) (io.Reader, error)) error
+}
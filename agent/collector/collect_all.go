@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// HostResult is the outcome of collecting from a single host, returned by
+// CollectAll so the caller can report per-host success/failure instead of
+// failing the whole run on the first error.
+type HostResult struct {
+	Host             string
+	SnapshotName     string
+	BytesTransferred int64
+	Blocks           []blockMetadata
+	Err              error
+}
+
+// ProgressReporter lets the caller (e.g. the CLI) render live feedback while
+// CollectAll fans work out across hosts, without the collector knowing
+// anything about how that feedback is displayed.
+type ProgressReporter interface {
+	Started(host string)
+	Finished(host string, result HostResult)
+}
+
+// noopProgressReporter is used when the caller doesn't care about progress.
+type noopProgressReporter struct{}
+
+func (noopProgressReporter) Started(string)              {}
+func (noopProgressReporter) Finished(string, HostResult) {}
+
+// CollectAll runs Collect against every agent concurrently, bounded by
+// concurrency workers, and returns one HostResult per agent in the same
+// order as agents. It is meant for HA Prometheus pairs and large clusters
+// where collecting hosts one at a time is prohibitively slow.
+func (collector *MetricsCollector) CollectAll(ctx context.Context, agents []SSHCollectingAgent, concurrency int, progress ProgressReporter) []HostResult {
+	if progress == nil {
+		progress = noopProgressReporter{}
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]HostResult, len(agents))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results[index] = collector.collectOne(ctx, agents[index], progress)
+			}
+		}()
+	}
+
+	for index := range agents {
+		select {
+		case jobs <- index:
+		case <-ctx.Done():
+			results[index] = HostResult{Host: agents[index].GetHost(), Err: ctx.Err()}
+		}
+	}
+	close(jobs)
+
+	wg.Wait()
+	return results
+}
+
+func (collector *MetricsCollector) collectOne(ctx context.Context, agent SSHCollectingAgent, progress ProgressReporter) HostResult {
+	host := agent.GetHost()
+	progress.Started(host)
+
+	result := HostResult{Host: host}
+
+	if ctx.Err() != nil {
+		result.Err = ctx.Err()
+		progress.Finished(host, result)
+		return result
+	}
+
+	outcome, err := collector.collect(ctx, agent)
+	result.SnapshotName = outcome.SnapshotName
+	result.Blocks = outcome.Blocks
+	result.BytesTransferred = outcome.BytesTransferred
+	result.Err = err
+
+	progress.Finished(host, result)
+	return result
+}
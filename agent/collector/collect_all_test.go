@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// discardLogger keeps these tests quiet instead of spamming logrus's default
+// stderr output on every Connect failure they deliberately trigger.
+func discardLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// fakeAgent is just enough of an SSHCollectingAgent to drive collect()
+// through a fast, deterministic failure (connectErr) without touching a real
+// remote host, so CollectAll's dispatch/concurrency behavior can be tested
+// in isolation.
+type fakeAgent struct {
+	host       string
+	connectErr error
+}
+
+func (a *fakeAgent) Connect() error  { return a.connectErr }
+func (a *fakeAgent) GetHost() string { return a.host }
+func (a *fakeAgent) ExecuteCommand(string) (*bytes.Buffer, *bytes.Buffer, error) {
+	return &bytes.Buffer{}, &bytes.Buffer{}, nil
+}
+func (a *fakeAgent) ExecuteCommandWithInput(string, []byte) (*bytes.Buffer, *bytes.Buffer, error) {
+	return &bytes.Buffer{}, &bytes.Buffer{}, nil
+}
+func (a *fakeAgent) ExecuteCommandStreaming(string, []byte) (io.ReadCloser, *bytes.Buffer, error) {
+	return io.NopCloser(bytes.NewReader(nil)), &bytes.Buffer{}, nil
+}
+func (a *fakeAgent) ReceiveDir(string, string, func(io.Reader) (io.Reader, error)) error {
+	return nil
+}
+
+func TestCollectAllReturnsOneResultPerAgent(t *testing.T) {
+	collector := &MetricsCollector{Settings: MetricsCollectorDefaultSettings(), Log: NewLogrusAdapter(discardLogger())}
+
+	agents := make([]SSHCollectingAgent, 0, 5)
+	for i := 0; i < 5; i++ {
+		agents = append(agents, &fakeAgent{host: string(rune('a' + i)), connectErr: errors.New("boom")})
+	}
+
+	results := collector.CollectAll(context.Background(), agents, 2, nil)
+
+	if len(results) != len(agents) {
+		t.Fatalf("expected %d results, got %d", len(agents), len(results))
+	}
+	for i, result := range results {
+		if result.Host != agents[i].GetHost() {
+			t.Errorf("result %d: expected host %q, got %q", i, agents[i].GetHost(), result.Host)
+		}
+		if result.Err == nil {
+			t.Errorf("result %d: expected the connect error to surface, got nil", i)
+		}
+	}
+}
+
+func TestCollectAllHonorsCancellation(t *testing.T) {
+	collector := &MetricsCollector{Settings: MetricsCollectorDefaultSettings(), Log: NewLogrusAdapter(discardLogger())}
+
+	agents := make([]SSHCollectingAgent, 0, 3)
+	for i := 0; i < 3; i++ {
+		agents = append(agents, &fakeAgent{host: string(rune('a' + i))})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := collector.CollectAll(ctx, agents, 1, nil)
+
+	if len(results) != len(agents) {
+		t.Fatalf("expected %d results, got %d", len(agents), len(results))
+	}
+	for i, result := range results {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("result %d: expected context.Canceled, got %v", i, result.Err)
+		}
+	}
+}
+
+func TestCollectAllConcurrencyFloor(t *testing.T) {
+	collector := &MetricsCollector{Settings: MetricsCollectorDefaultSettings(), Log: NewLogrusAdapter(discardLogger())}
+
+	agents := []SSHCollectingAgent{&fakeAgent{host: "only", connectErr: errors.New("boom")}}
+
+	// concurrency < 1 must not deadlock or panic; it's clamped to 1.
+	done := make(chan []HostResult, 1)
+	go func() { done <- collector.CollectAll(context.Background(), agents, 0, nil) }()
+
+	select {
+	case results := <-done:
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result, got %d", len(results))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("CollectAll did not return with concurrency 0")
+	}
+}
@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+/*
+Constants
+*/
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	CompressionLZ4  = "lz4"
+)
+
+const probeCompressProgramTemplate = "command -v %s >/dev/null 2>&1"
+const tarCompressProgramTemplate = `tar --use-compress-program="%s" -cf %s -C %s .`
+
+// compressionExtension is appended to temporalSnapshotTarballPath so the
+// tarball name reflects what it actually contains.
+var compressionExtension = map[string]string{
+	CompressionNone: "",
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+	CompressionLZ4:  ".lz4",
+}
+
+// compressionRemoteProgram is the binary probed for and invoked on the
+// remote host via tar's --use-compress-program.
+var compressionRemoteProgram = map[string]string{
+	CompressionGzip: "gzip",
+	CompressionZstd: "zstd",
+	CompressionLZ4:  "lz4",
+}
+
+// resolveCompression probes the remote host for the requested codec and
+// falls back to gzip (which ships with tar everywhere) if it isn't
+// available, so a missing binary on the remote host never aborts the
+// collection outright.
+func (collector *MetricsCollector) resolveCompression(agent SSHCollectingAgent) string {
+	codec := collector.Settings.Compression
+	if codec == "" {
+		codec = CompressionNone
+	}
+	if codec == CompressionNone {
+		return codec
+	}
+
+	log := collector.Log.With(map[string]interface{}{"host": agent.GetHost(), "step": "compression"})
+
+	program, known := compressionRemoteProgram[codec]
+	if !known {
+		log.Warn("Unknown compression codec '" + codec + "', falling back to gzip")
+		return CompressionGzip
+	}
+
+	command := fmt.Sprintf(probeCompressProgramTemplate, program)
+	_, _, err := agent.ExecuteCommand(command)
+	if err != nil {
+		log.Warn("Compression codec '" + codec + "' not available on remote host, falling back to gzip")
+		return CompressionGzip
+	}
+
+	return codec
+}
+
+func (collector *MetricsCollector) tarballSnapshotWithCodec(agent SSHCollectingAgent, src string, dest string, codec string) error {
+	if codec == CompressionNone {
+		return collector.tarballSnapshot(agent, src, dest)
+	}
+
+	program := compressionRemoteProgram[codec]
+	if collector.Settings.CompressionLevel > 0 {
+		program = fmt.Sprintf("%s -%d", program, collector.Settings.CompressionLevel)
+	}
+
+	command := fmt.Sprintf(tarCompressProgramTemplate, program, dest, src)
+	_, serr, err := agent.ExecuteCommand(command)
+	if err != nil {
+		return err
+	}
+	if serr.Len() > 0 {
+		return errors.New("Failed to create snapshot tarball: " + serr.String())
+	}
+
+	return nil
+}
+
+// decompressorFor returns a reader wrapper that transparently decompresses
+// the downloaded tarball so collector.Path/snapshot always ends up holding
+// the extracted block layout, whatever codec was used on the remote end.
+func decompressorFor(codec string) (func(io.Reader) (io.Reader, error), error) {
+	switch codec {
+	case "", CompressionNone:
+		return nil, nil
+	case CompressionGzip:
+		return func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		}, nil
+	case CompressionZstd:
+		return func(r io.Reader) (io.Reader, error) {
+			decoder, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return decoder.IOReadCloser(), nil
+		}, nil
+	case CompressionLZ4:
+		return func(r io.Reader) (io.Reader, error) {
+			return lz4.NewReader(r), nil
+		}, nil
+	default:
+		return nil, errors.New("unknown compression codec: " + codec)
+	}
+}
@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+func TestDecompressorForNoneReturnsNil(t *testing.T) {
+	for _, codec := range []string{"", CompressionNone} {
+		decompressor, err := decompressorFor(codec)
+		if err != nil {
+			t.Fatalf("codec %q: unexpected error: %v", codec, err)
+		}
+		if decompressor != nil {
+			t.Errorf("codec %q: expected a nil decompressor, got one", codec)
+		}
+	}
+}
+
+func TestDecompressorForUnknownCodec(t *testing.T) {
+	if _, err := decompressorFor("bzip2"); err == nil {
+		t.Fatal("expected an error for an unknown codec, got nil")
+	}
+}
+
+func TestDecompressorForGzipRoundTrips(t *testing.T) {
+	original := []byte("block contents to compress")
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	if _, err := gzipWriter.Write(original); err != nil {
+		t.Fatalf("failed to write gzip payload: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+
+	decompressor, err := decompressorFor(CompressionGzip)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reader, err := decompressor(&buf)
+	if err != nil {
+		t.Fatalf("decompressor returned error: %v", err)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read decompressed data: %v", err)
+	}
+	if !bytes.Equal(decoded, original) {
+		t.Errorf("expected %q, got %q", original, decoded)
+	}
+}
+
+func TestDecompressorForZstdRoundTrips(t *testing.T) {
+	original := []byte("block contents to compress")
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("failed to build zstd encoder: %v", err)
+	}
+	compressed := encoder.EncodeAll(original, nil)
+
+	decompressor, err := decompressorFor(CompressionZstd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reader, err := decompressor(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("decompressor returned error: %v", err)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read decompressed data: %v", err)
+	}
+	if !bytes.Equal(decoded, original) {
+		t.Errorf("expected %q, got %q", original, decoded)
+	}
+}
+
+func TestDecompressorForLZ4RoundTrips(t *testing.T) {
+	original := []byte("block contents to compress")
+
+	var buf bytes.Buffer
+	lz4Writer := lz4.NewWriter(&buf)
+	if _, err := lz4Writer.Write(original); err != nil {
+		t.Fatalf("failed to write lz4 payload: %v", err)
+	}
+	if err := lz4Writer.Close(); err != nil {
+		t.Fatalf("failed to close lz4 writer: %v", err)
+	}
+
+	decompressor, err := decompressorFor(CompressionLZ4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reader, err := decompressor(&buf)
+	if err != nil {
+		t.Fatalf("decompressor returned error: %v", err)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read decompressed data: %v", err)
+	}
+	if !bytes.Equal(decoded, original) {
+		t.Errorf("expected %q, got %q", original, decoded)
+	}
+}
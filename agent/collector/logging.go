@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// LoggerAdapter is the logging boundary of this package: MetricsCollector
+// only ever logs through it, so callers can plug in slog, zap, or the
+// existing logrus without the collector caring which one it's talking to.
+// Every call site is expected to attach stable fields (host, snapshot,
+// block_ulid, step, ...) via With rather than formatting them into the
+// message string.
+type LoggerAdapter interface {
+	With(fields map[string]interface{}) LoggerAdapter
+	Debug(msg string)
+	Info(msg string)
+	Warn(msg string)
+	Error(msg string)
+}
+
+// logrusAdapter is the default LoggerAdapter, wrapping the *logrus.Logger
+// this package has always taken.
+type logrusAdapter struct {
+	entry *logrus.Entry
+}
+
+// NewLogrusAdapter wraps an existing *logrus.Logger as a LoggerAdapter.
+func NewLogrusAdapter(logger *logrus.Logger) LoggerAdapter {
+	return &logrusAdapter{entry: logrus.NewEntry(logger)}
+}
+
+func (adapter *logrusAdapter) With(fields map[string]interface{}) LoggerAdapter {
+	return &logrusAdapter{entry: adapter.entry.WithFields(fields)}
+}
+
+func (adapter *logrusAdapter) Debug(msg string) { adapter.entry.Debug(msg) }
+func (adapter *logrusAdapter) Info(msg string)  { adapter.entry.Info(msg) }
+func (adapter *logrusAdapter) Warn(msg string)  { adapter.entry.Warn(msg) }
+func (adapter *logrusAdapter) Error(msg string) { adapter.entry.Error(msg) }
@@ -1,13 +1,16 @@
 package collector
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/sirupsen/logrus"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 /*
@@ -21,13 +24,19 @@ const temporalSnapshotTarballPath = "/tmp/InstaclustrCollection.tar"
 const createSnapshotTarballTemplate = "tar -cf %s -C %s ."
 const getSnapshotBlockListTemplate = "ls -d %s/*/"
 const getSnapshotBlockMetadataTemplate = "cat %s/meta.json"
+const remoteSizeTemplate = "du -sb %s | cut -f1"
 
 /*
 Settings
 */
 type MetricsCollectorSettings struct {
-	Prometheus     PrometheusSettings `yaml:"prometheus"`
-	CopyCompressed bool               `yaml:"copy_compressed"`
+	Prometheus                PrometheusSettings `yaml:"prometheus"`
+	CopyCompressed            bool               `yaml:"copy_compressed"`
+	Upload                    UploadSettings     `yaml:"upload"`
+	AllowUnknownBlockVersions bool               `yaml:"allow_unknown_block_versions"`
+	RemoteRead                RemoteReadSettings `yaml:"remote_read"`
+	Compression               string             `yaml:"compression"`
+	CompressionLevel          int                `yaml:"compression_level"`
 }
 
 type PrometheusSettings struct {
@@ -42,6 +51,7 @@ func MetricsCollectorDefaultSettings() *MetricsCollectorSettings {
 			DataPath: "/var/data",
 		},
 		CopyCompressed: true,
+		Compression:    CompressionNone,
 	}
 }
 
@@ -50,51 +60,147 @@ Collector
 */
 type MetricsCollector struct {
 	Settings *MetricsCollectorSettings
-	Logger   *logrus.Logger
+	Log      LoggerAdapter
 	Path     string
 
 	TimestampFrom time.Time
 	TimestampTo   time.Time
 }
 
+// NewMetricsCollector builds a MetricsCollector logging through the given
+// *logrus.Logger, which is how this package has always been wired up.
+// Callers who want slog, zap, or anything else can instead set Log directly
+// to their own LoggerAdapter.
+func NewMetricsCollector(settings *MetricsCollectorSettings, logger *logrus.Logger, path string, timestampFrom time.Time, timestampTo time.Time) *MetricsCollector {
+	return &MetricsCollector{
+		Settings:      settings,
+		Log:           NewLogrusAdapter(logger),
+		Path:          path,
+		TimestampFrom: timestampFrom,
+		TimestampTo:   timestampTo,
+	}
+}
+
 func (collector *MetricsCollector) Collect(agent SSHCollectingAgent) error {
-	log := collector.Logger.WithFields(logrus.Fields{
-		"prefix": "MC " + agent.GetHost(),
-	})
+	_, err := collector.collect(context.Background(), agent)
+	return err
+}
+
+// collectOutcome carries back the facts CollectAll needs for its per-host
+// HostResult, without Collect's callers having to parse log lines.
+type collectOutcome struct {
+	SnapshotName     string
+	Blocks           []blockMetadata
+	BytesTransferred int64
+}
+
+func (collector *MetricsCollector) collect(ctx context.Context, agent SSHCollectingAgent) (*collectOutcome, error) {
+	outcome := &collectOutcome{}
+	started := time.Now()
+
+	if err := ctx.Err(); err != nil {
+		return outcome, err
+	}
+
+	if collector.Settings.RemoteRead.Enabled {
+		bytesWritten, err := collector.CollectRemoteRead(ctx, agent)
+		outcome.BytesTransferred = bytesWritten
+		return outcome, err
+	}
+
+	log := collector.Log.With(map[string]interface{}{"host": agent.GetHost(), "step": "collect"})
 	log.Info("Metrics collecting started")
+	defer func() {
+		collector.Log.With(map[string]interface{}{
+			"host":        agent.GetHost(),
+			"step":        "collect_summary",
+			"snapshot":    outcome.SnapshotName,
+			"blocks_kept": len(outcome.Blocks),
+			"bytes":       outcome.BytesTransferred,
+			"duration_ms": time.Since(started).Milliseconds(),
+		}).Info("Metrics collecting summary")
+	}()
 
 	err := agent.Connect()
 	if err != nil {
-		log.Error(err)
-		return err
+		log.Error(err.Error())
+		return outcome, err
 	}
 
 	log.Info("Creating snapshot...")
 	snapshot, err := collector.createSnapshot(agent)
 	if err != nil {
-		log.Error(err)
-		return err
+		log.Error(err.Error())
+		return outcome, err
 	}
+	log = log.With(map[string]interface{}{"host": agent.GetHost(), "step": "collect", "snapshot": snapshot})
 	log.Info("Creating snapshot  OK")
-	log.Info("Snapshot name: ", snapshot)
+	outcome.SnapshotName = snapshot
 
 	resourceName := "snapshot"
 	src := filepath.Join(collector.Settings.Prometheus.DataPath, prometheusSnapshotFolder, snapshot)
 
 	{
 		log.Info("Lightening snapshot...")
-		err := collector.lightenSnapshot(agent, src)
+		kept, err := collector.lightenSnapshot(agent, src)
 		if err != nil {
 			log.Warn("Failed to lighten snapshot: " + err.Error())
 		}
+		outcome.Blocks = kept
 		log.Info("Lightening snapshot  OK")
 	}
 
+	if collector.Settings.Upload.Backend != UploadBackendNone {
+		sink, err := NewSnapshotSink(collector.Settings.Upload)
+		if err != nil {
+			log.Error(err.Error())
+			return outcome, err
+		}
+
+		log.With(map[string]interface{}{"backend": sink.Name()}).Info("Uploading snapshot...")
+		manifest := snapshotManifest{
+			Snapshot:      snapshot,
+			TimestampFrom: collector.TimestampFrom.UnixMilli(),
+			TimestampTo:   collector.TimestampTo.UnixMilli(),
+			Blocks:        outcome.Blocks,
+		}
+		uploadErr := sink.Upload(agent, src, manifest)
+		if uploadErr != nil {
+			log.Error(uploadErr.Error())
+			return outcome, uploadErr
+		}
+		log.Info("Uploading snapshot  OK")
+
+		if size, sizeErr := collector.remoteSize(agent, src); sizeErr == nil {
+			outcome.BytesTransferred = size
+		} else {
+			log.Warn("Failed to determine uploaded snapshot size: " + sizeErr.Error())
+		}
+
+		if !collector.Settings.Upload.KeepLocal {
+			log.Info("Cleanup snapshot...")
+			err = collector.removeResource(agent, src)
+			if err != nil {
+				log.Error(err.Error())
+			} else {
+				log.Info("Cleanup snapshot  OK")
+			}
+
+			log.Info("Metrics collecting completed")
+			return outcome, nil
+		}
+	}
+
+	codec := CompressionNone
+
 	if collector.Settings.CopyCompressed {
-		log.Info("Creating snapshot tarball...")
-		tarballErr := collector.tarballSnapshot(agent, src, temporalSnapshotTarballPath)
+		codec = collector.resolveCompression(agent)
+		tarballPath := temporalSnapshotTarballPath + compressionExtension[codec]
+
+		log.With(map[string]interface{}{"codec": codec}).Info("Creating snapshot tarball...")
+		tarballErr := collector.tarballSnapshotWithCodec(agent, src, tarballPath, codec)
 		if tarballErr != nil {
-			log.Error(tarballErr)
+			log.Error(tarballErr.Error())
 		} else {
 			log.Info("Creating snapshot tarball  OK")
 		}
@@ -102,39 +208,53 @@ func (collector *MetricsCollector) Collect(agent SSHCollectingAgent) error {
 		log.Info("Cleanup snapshot...")
 		err = collector.removeResource(agent, src)
 		if err != nil {
-			log.Error(err)
+			log.Error(err.Error())
 		} else {
 			log.Info("Cleanup snapshot  OK")
 		}
 
 		if tarballErr != nil {
-			return tarballErr
+			return outcome, tarballErr
 		}
 
-		src = temporalSnapshotTarballPath
+		src = tarballPath
 		resourceName = "snapshot tarball"
 	}
 
 	dest := filepath.Join(collector.Path, "snapshot")
 
-	log.Info("Downloading snapshot...")
-	err = collector.downloadSnapshot(agent, src, dest)
-	if err != nil {
-		log.Error(err)
+	// The remote resource must be dropped even if the context is cancelled
+	// mid-download, otherwise a cancelled CollectAll run leaks tarballs and
+	// snapshot directories on the remote host.
+	defer func() {
+		log.Info(fmt.Sprint("Cleanup ", resourceName, "..."))
+		if err := collector.removeResource(agent, src); err != nil {
+			log.Error(err.Error())
+		} else {
+			log.Info(fmt.Sprint("Cleanup ", resourceName, "  OK"))
+		}
+	}()
+
+	if size, sizeErr := collector.remoteSize(agent, src); sizeErr == nil {
+		outcome.BytesTransferred = size
 	} else {
-		log.Info("Downloading snapshot  OK")
+		log.Warn("Failed to determine remote size of " + resourceName + ": " + sizeErr.Error())
+	}
+
+	if err := ctx.Err(); err != nil {
+		return outcome, err
 	}
 
-	log.Info(fmt.Sprint("Cleanup ", resourceName, "..."))
-	err = collector.removeResource(agent, src)
+	log.With(map[string]interface{}{"bytes": outcome.BytesTransferred}).Info("Downloading snapshot...")
+	err = collector.downloadSnapshot(agent, src, dest, codec)
 	if err != nil {
-		log.Error(err)
-		return err
+		log.Error(err.Error())
+		return outcome, err
 	}
-	log.Info(fmt.Sprint("Cleanup ", resourceName, "  OK"))
+	log.Info("Downloading snapshot  OK")
 
 	log.Info("Metrics collecting completed")
-	return nil
+	return outcome, nil
 }
 
 func (collector *MetricsCollector) createSnapshot(agent SSHCollectingAgent) (string, error) {
@@ -168,47 +288,138 @@ func (collector *MetricsCollector) createSnapshot(agent SSHCollectingAgent) (str
 	return response.Data.Name, nil
 }
 
-func (collector *MetricsCollector) lightenSnapshot(agent SSHCollectingAgent, src string) error {
+// supportedBlockVersions are the meta.json schema versions this collector
+// knows how to read the compaction/thanos fields of. Prometheus itself has
+// only ever written version 1, but downstream forks have started bumping it
+// as the schema gained fields, so version 2 is accepted too. Any other
+// version is skipped unless AllowUnknownBlockVersions is set.
+var supportedBlockVersions = map[int]bool{1: true, 2: true}
+
+type blockEntry struct {
+	path     string
+	metadata *blockMetadata
+}
+
+func (collector *MetricsCollector) lightenSnapshot(agent SSHCollectingAgent, src string) ([]blockMetadata, error) {
 	blocks, err := getBlockList(agent, src)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for index, block := range blocks {
+	entries := make([]blockEntry, 0, len(blocks))
+	for _, block := range blocks {
 		metadata, err := getBlockMetadata(agent, block)
 		if err != nil {
-			collector.Logger.Warn("Ignoring block (" + block + "): " + err.Error())
+			collector.Log.With(map[string]interface{}{"host": agent.GetHost(), "step": "lighten"}).
+				Warn("Ignoring block (" + block + "): " + err.Error())
 			continue
 		}
 
-		if metadata.Version != 1 {
-			collector.Logger.Warn("Ignoring block (", block, "): version #", metadata.Version, " unsupported")
-			continue
+		blockLog := collector.Log.With(map[string]interface{}{
+			"host":         agent.GetHost(),
+			"step":         "lighten",
+			"block_ulid":   metadata.Ulid,
+			"block_min_ts": metadata.MinTime,
+			"block_max_ts": metadata.MaxTime,
+		})
+
+		if !supportedBlockVersions[metadata.Version] {
+			if !collector.Settings.AllowUnknownBlockVersions {
+				blockLog.Warn(fmt.Sprint("Ignoring block (", block, "): version #", metadata.Version, " unsupported"))
+				continue
+			}
+			blockLog.Warn(fmt.Sprint("Block (", block, ") has unsupported version #", metadata.Version, ", keeping it anyway"))
 		}
 
-		blockMinTimestamp := time.Unix(metadata.MinTime/int64(1000), (metadata.MinTime%int64(1000))*int64(1000000)).UTC()
-		blockMaxTimestamp := time.Unix(metadata.MaxTime/int64(1000), (metadata.MaxTime%int64(1000))*int64(1000000)).UTC()
+		entries = append(entries, blockEntry{path: block, metadata: metadata})
+	}
 
-		fallsIntoTheSelectedTimeRange := false
-		logMessage := "will be skipped"
+	retain := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		blockMinTimestamp := time.Unix(entry.metadata.MinTime/int64(1000), (entry.metadata.MinTime%int64(1000))*int64(1000000)).UTC()
+		blockMaxTimestamp := time.Unix(entry.metadata.MaxTime/int64(1000), (entry.metadata.MaxTime%int64(1000))*int64(1000000)).UTC()
 
 		if (blockMinTimestamp.After(collector.TimestampFrom) || blockMaxTimestamp.After(collector.TimestampFrom)) &&
 			(blockMinTimestamp.Before(collector.TimestampTo) || blockMaxTimestamp.Before(collector.TimestampTo)) {
-			fallsIntoTheSelectedTimeRange = true
-			logMessage = "falls into the time span"
+			retain[entry.metadata.Ulid] = true
 		}
+	}
+
+	// A block that a retained block was compacted from must stay too, and so
+	// must *its* parents, and so on - compaction trees are routinely more
+	// than one level deep (raw -> 2h -> 2d -> ...). Walk to a fixpoint
+	// instead of a single pass so grandparents aren't dropped.
+	retainCompactionAncestors(entries, retain)
 
-		collector.Logger.Info("Block ", index+1, "/", len(blocks), " ", metadata.Ulid, "  ", blockMinTimestamp, " .. ", blockMaxTimestamp, ": ", logMessage)
+	var kept []blockMetadata
+	dropped := 0
+
+	for index, entry := range entries {
+		logMessage := "will be skipped"
+		if retain[entry.metadata.Ulid] {
+			logMessage = "falls into the time span"
+		}
 
-		if !fallsIntoTheSelectedTimeRange {
-			err := collector.removeResource(agent, block)
+		collector.Log.With(map[string]interface{}{
+			"host":             agent.GetHost(),
+			"step":             "lighten",
+			"block_ulid":       entry.metadata.Ulid,
+			"block_min_ts":     entry.metadata.MinTime,
+			"block_max_ts":     entry.metadata.MaxTime,
+			"compaction_level": entry.metadata.Compaction.Level,
+		}).Info(fmt.Sprint("Block ", index+1, "/", len(entries), ": ", logMessage))
+
+		if !retain[entry.metadata.Ulid] {
+			dropped++
+			err := collector.removeResource(agent, entry.path)
 			if err != nil {
-				collector.Logger.Warn("Failed to drop snapshot block: " + err.Error())
+				collector.Log.With(map[string]interface{}{"host": agent.GetHost(), "step": "lighten"}).
+					Warn("Failed to drop snapshot block: " + err.Error())
 			}
+			continue
 		}
+
+		kept = append(kept, *entry.metadata)
 	}
 
-	return nil
+	collector.Log.With(map[string]interface{}{
+		"host":           agent.GetHost(),
+		"step":           "lighten_summary",
+		"blocks_kept":    len(kept),
+		"blocks_dropped": dropped,
+	}).Info("Snapshot lightening completed")
+
+	return kept, nil
+}
+
+// retainCompactionAncestors expands retain in place to include every
+// transitive Compaction.Parents of an already-retained block, iterating
+// until a pass adds nothing new. entries not present in retain and without a
+// retained descendant are left untouched.
+func retainCompactionAncestors(entries []blockEntry, retain map[string]bool) {
+	byUlid := make(map[string]blockEntry, len(entries))
+	for _, entry := range entries {
+		byUlid[entry.metadata.Ulid] = entry
+	}
+
+	for {
+		expanded := false
+		for ulid := range retain {
+			entry, found := byUlid[ulid]
+			if !found {
+				continue
+			}
+			for _, parent := range entry.metadata.Compaction.Parents {
+				if !retain[parent.Ulid] {
+					retain[parent.Ulid] = true
+					expanded = true
+				}
+			}
+		}
+		if !expanded {
+			break
+		}
+	}
 }
 
 func getBlockList(agent SSHCollectingAgent, src string) ([]string, error) {
@@ -224,12 +435,26 @@ func getBlockList(agent SSHCollectingAgent, src string) ([]string, error) {
 	return strings.Fields(sout.String()), nil
 }
 
-type blockMetadata struct {
+type blockMetadataParent struct {
 	Ulid    string
-	Version int
 	MinTime int64
 	MaxTime int64
-	Stats   struct {
+}
+
+type blockMetadataCompaction struct {
+	Level   int
+	Sources []string
+	Parents []blockMetadataParent
+}
+
+type blockMetadata struct {
+	Ulid       string
+	Version    int
+	MinTime    int64
+	MaxTime    int64
+	Compaction blockMetadataCompaction
+	Thanos     json.RawMessage `json:",omitempty"`
+	Stats      struct {
 		NumSamples uint64
 		NumSeries  uint64
 		NumChunks  uint64
@@ -268,8 +493,13 @@ func (collector *MetricsCollector) tarballSnapshot(agent SSHCollectingAgent, src
 	return nil
 }
 
-func (collector *MetricsCollector) downloadSnapshot(agent SSHCollectingAgent, src string, dest string) error {
-	err := agent.ReceiveDir(src, dest, nil)
+func (collector *MetricsCollector) downloadSnapshot(agent SSHCollectingAgent, src string, dest string, codec string) error {
+	decompressor, err := decompressorFor(codec)
+	if err != nil {
+		return err
+	}
+
+	err = agent.ReceiveDir(src, dest, decompressor)
 	if err != nil {
 		return errors.New("Failed to receive snapshot (" + err.Error() + ")")
 	}
@@ -277,6 +507,19 @@ func (collector *MetricsCollector) downloadSnapshot(agent SSHCollectingAgent, sr
 	return nil
 }
 
+func (collector *MetricsCollector) remoteSize(agent SSHCollectingAgent, path string) (int64, error) {
+	command := fmt.Sprintf(remoteSizeTemplate, path)
+	sout, serr, err := agent.ExecuteCommand(command)
+	if err != nil {
+		return 0, err
+	}
+	if serr.Len() > 0 {
+		return 0, errors.New("Failed to determine remote size: " + serr.String())
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(sout.String()), 10, 64)
+}
+
 func (collector *MetricsCollector) removeResource(agent SSHCollectingAgent, path string) error {
 	_, _, err := agent.ExecuteCommand(fmt.Sprintf(prometheusRemoveResourceTemplate, path))
 
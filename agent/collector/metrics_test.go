@@ -0,0 +1,66 @@
+package collector
+
+import "testing"
+
+func blockWithParents(ulid string, parents ...string) blockEntry {
+	entry := blockEntry{path: ulid, metadata: &blockMetadata{Ulid: ulid}}
+	for _, parent := range parents {
+		entry.metadata.Compaction.Parents = append(entry.metadata.Compaction.Parents, blockMetadataParent{Ulid: parent})
+	}
+	return entry
+}
+
+func TestRetainCompactionAncestorsWalksMultiLevelTree(t *testing.T) {
+	// raw -> 2h -> 2d, only the 2d block is in range.
+	entries := []blockEntry{
+		blockWithParents("raw"),
+		blockWithParents("2h", "raw"),
+		blockWithParents("2d", "2h"),
+	}
+	retain := map[string]bool{"2d": true}
+
+	retainCompactionAncestors(entries, retain)
+
+	for _, ulid := range []string{"raw", "2h", "2d"} {
+		if !retain[ulid] {
+			t.Errorf("expected %q to be retained as a compaction ancestor, got %v", ulid, retain)
+		}
+	}
+}
+
+func TestRetainCompactionAncestorsLeavesUnrelatedBlocks(t *testing.T) {
+	entries := []blockEntry{
+		blockWithParents("raw"),
+		blockWithParents("2h", "raw"),
+		blockWithParents("unrelated"),
+	}
+	retain := map[string]bool{"2h": true}
+
+	retainCompactionAncestors(entries, retain)
+
+	if !retain["raw"] {
+		t.Errorf("expected parent %q to be retained, got %v", "raw", retain)
+	}
+	if retain["unrelated"] {
+		t.Errorf("expected unrelated block to stay dropped, got %v", retain)
+	}
+}
+
+func TestRetainCompactionAncestorsTerminatesOnMissingParent(t *testing.T) {
+	// The parent ULID isn't among entries (e.g. it was already compacted
+	// away on the remote host); the walk must still converge rather than
+	// looping forever chasing an entry that will never be found.
+	entries := []blockEntry{
+		blockWithParents("2h", "raw-not-in-entries"),
+	}
+	retain := map[string]bool{"2h": true}
+
+	retainCompactionAncestors(entries, retain)
+
+	if !retain["raw-not-in-entries"] {
+		t.Errorf("expected the dangling parent ulid to still be recorded in retain, got %v", retain)
+	}
+	if len(retain) != 2 {
+		t.Errorf("expected exactly 2 ulids in retain, got %v", retain)
+	}
+}
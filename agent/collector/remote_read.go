@@ -0,0 +1,268 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage/remote"
+)
+
+/*
+Constants
+*/
+const remoteReadFolder = "remote_read"
+const remoteReadResponseFile = "series.prompb"
+const remoteReadTemplate = "curl -s -XPOST -H 'Content-Type: application/x-protobuf' -H 'Content-Encoding: snappy' " +
+	"-H 'X-Prometheus-Remote-Read-Version: 0.1.0' --data-binary @- http://localhost:%d/api/v1/read"
+
+// defaultMaxBytesInFrame caps a single chunked frame when the setting is
+// left at its zero value, matching Prometheus's own client default.
+const defaultMaxBytesInFrame = 1024 * 1024
+
+/*
+Settings
+*/
+type RemoteReadSettings struct {
+	Enabled         bool     `yaml:"enabled"`
+	Matchers        []string `yaml:"matchers"`
+	ChunkedResponse bool     `yaml:"chunked_response"`
+	MaxBytesInFrame int      `yaml:"max_bytes_in_frame"`
+}
+
+// CollectRemoteRead pulls only the series matching the configured matchers
+// out of Prometheus's remote-read endpoint, instead of snapshotting and
+// tarballing the whole TSDB. It is meant for targeted support requests where
+// hauling the full snapshot would be wasteful.
+func (collector *MetricsCollector) CollectRemoteRead(ctx context.Context, agent SSHCollectingAgent) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	started := time.Now()
+	log := collector.Log.With(map[string]interface{}{"host": agent.GetHost(), "step": "remote_read"})
+	log.Info("Remote-read collecting started")
+	defer func() {
+		collector.Log.With(map[string]interface{}{
+			"host":        agent.GetHost(),
+			"step":        "remote_read_summary",
+			"duration_ms": time.Since(started).Milliseconds(),
+		}).Info("Remote-read collecting summary")
+	}()
+
+	err := agent.Connect()
+	if err != nil {
+		log.Error(err.Error())
+		return 0, err
+	}
+
+	request, err := collector.buildReadRequest()
+	if err != nil {
+		log.Error(err.Error())
+		return 0, err
+	}
+
+	body, err := proto.Marshal(request)
+	if err != nil {
+		return 0, errors.New("Failed to marshal remote-read request (" + err.Error() + ")")
+	}
+	compressed := snappy.Encode(nil, body)
+
+	command := fmt.Sprintf(remoteReadTemplate, collector.Settings.Prometheus.Port)
+
+	dest := filepath.Join(collector.Path, remoteReadFolder)
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return 0, errors.New("Failed to create remote-read destination (" + err.Error() + ")")
+	}
+	destFile := filepath.Join(dest, remoteReadResponseFile)
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	log.Info("Streaming matched series...")
+	stream, serr, err := agent.ExecuteCommandStreaming(command, compressed)
+	if err != nil {
+		log.Error(err.Error())
+		return 0, err
+	}
+	defer stream.Close()
+
+	var frames int
+	var bytesWritten int64
+	if collector.Settings.RemoteRead.ChunkedResponse {
+		frames, bytesWritten, err = collector.writeChunkedFrames(ctx, stream, destFile)
+	} else {
+		frames, bytesWritten, err = collector.writeSampledResponse(stream, destFile)
+	}
+	if err != nil {
+		log.Error(err.Error())
+		return bytesWritten, err
+	}
+
+	if serr.Len() > 0 {
+		err := errors.New("Failed to read remote series: " + serr.String())
+		log.Error(err.Error())
+		return bytesWritten, err
+	}
+
+	log.With(map[string]interface{}{"frames": frames, "bytes": bytesWritten}).Info("Remote-read collecting completed")
+	return bytesWritten, nil
+}
+
+// writeChunkedFrames decodes the STREAMED_XOR_CHUNKS response one
+// prompb.ChunkedReadResponse at a time, bounded by MaxBytesInFrame, and
+// appends each decoded frame length-prefixed to destFile. Only one frame is
+// ever held in memory at a time, regardless of how large the overall series
+// selection is.
+func (collector *MetricsCollector) writeChunkedFrames(ctx context.Context, stream io.Reader, destFile string) (int, int64, error) {
+	maxBytesInFrame := collector.Settings.RemoteRead.MaxBytesInFrame
+	if maxBytesInFrame <= 0 {
+		maxBytesInFrame = defaultMaxBytesInFrame
+	}
+
+	out, err := os.Create(destFile)
+	if err != nil {
+		return 0, 0, errors.New("Failed to create remote-read destination file (" + err.Error() + ")")
+	}
+	defer out.Close()
+
+	writer := bufio.NewWriter(out)
+	defer writer.Flush()
+
+	reader := remote.NewChunkedReader(stream, uint64(maxBytesInFrame), nil)
+
+	frames := 0
+	var bytesWritten int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return frames, bytesWritten, err
+		}
+
+		var frame prompb.ChunkedReadResponse
+		err := reader.NextProto(&frame)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return frames, bytesWritten, errors.New("Failed to decode remote-read frame (" + err.Error() + ")")
+		}
+
+		frameBytes, err := proto.Marshal(&frame)
+		if err != nil {
+			return frames, bytesWritten, errors.New("Failed to re-marshal remote-read frame (" + err.Error() + ")")
+		}
+
+		if err := writeLengthPrefixed(writer, frameBytes); err != nil {
+			return frames, bytesWritten, err
+		}
+
+		frames++
+		bytesWritten += int64(len(frameBytes))
+	}
+
+	return frames, bytesWritten, nil
+}
+
+// writeSampledResponse decodes the (non-chunked) SAMPLES response - a single
+// snappy-compressed prompb.ReadResponse - and persists it as one decoded
+// frame per query result, rather than the opaque bytes curl produced.
+func (collector *MetricsCollector) writeSampledResponse(stream io.Reader, destFile string) (int, int64, error) {
+	compressed, err := io.ReadAll(stream)
+	if err != nil {
+		return 0, 0, errors.New("Failed to read remote-read response (" + err.Error() + ")")
+	}
+
+	decompressed, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return 0, 0, errors.New("Failed to decompress remote-read response (" + err.Error() + ")")
+	}
+
+	var response prompb.ReadResponse
+	if err := proto.Unmarshal(decompressed, &response); err != nil {
+		return 0, 0, errors.New("Failed to decode remote-read response (" + err.Error() + ")")
+	}
+
+	out, err := os.Create(destFile)
+	if err != nil {
+		return 0, 0, errors.New("Failed to create remote-read destination file (" + err.Error() + ")")
+	}
+	defer out.Close()
+
+	writer := bufio.NewWriter(out)
+	defer writer.Flush()
+
+	var bytesWritten int64
+	for _, result := range response.Results {
+		resultBytes, err := proto.Marshal(result)
+		if err != nil {
+			return 0, bytesWritten, errors.New("Failed to re-marshal remote-read result (" + err.Error() + ")")
+		}
+		if err := writeLengthPrefixed(writer, resultBytes); err != nil {
+			return 0, bytesWritten, err
+		}
+		bytesWritten += int64(len(resultBytes))
+	}
+
+	return len(response.Results), bytesWritten, nil
+}
+
+func writeLengthPrefixed(writer *bufio.Writer, payload []byte) error {
+	var length [4]byte
+	length[0] = byte(len(payload) >> 24)
+	length[1] = byte(len(payload) >> 16)
+	length[2] = byte(len(payload) >> 8)
+	length[3] = byte(len(payload))
+
+	if _, err := writer.Write(length[:]); err != nil {
+		return errors.New("Failed to write remote-read frame length (" + err.Error() + ")")
+	}
+	if _, err := writer.Write(payload); err != nil {
+		return errors.New("Failed to write remote-read frame (" + err.Error() + ")")
+	}
+	return nil
+}
+
+func (collector *MetricsCollector) buildReadRequest() (*prompb.ReadRequest, error) {
+	settings := collector.Settings.RemoteRead
+
+	var matchers []*prompb.LabelMatcher
+	for _, rawMatcher := range settings.Matchers {
+		matcher, err := parser.ParseMetricSelector(rawMatcher)
+		if err != nil {
+			return nil, errors.New("Failed to parse matcher '" + rawMatcher + "' (" + err.Error() + ")")
+		}
+		for _, m := range matcher {
+			matchers = append(matchers, &prompb.LabelMatcher{
+				Type:  prompb.LabelMatcher_Type(m.Type),
+				Name:  m.Name,
+				Value: m.Value,
+			})
+		}
+	}
+
+	responseType := prompb.ReadRequest_SAMPLES
+	if settings.ChunkedResponse {
+		responseType = prompb.ReadRequest_STREAMED_XOR_CHUNKS
+	}
+
+	return &prompb.ReadRequest{
+		Queries: []*prompb.Query{
+			{
+				StartTimestampMs: collector.TimestampFrom.UnixMilli(),
+				EndTimestampMs:   collector.TimestampTo.UnixMilli(),
+				Matchers:         matchers,
+			},
+		},
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{responseType},
+	}, nil
+}
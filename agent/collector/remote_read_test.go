@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestWriteLengthPrefixedRoundTrips(t *testing.T) {
+	var buf bytes.Buffer
+	writer := bufio.NewWriter(&buf)
+
+	payload := []byte("some protobuf-shaped bytes")
+	if err := writeLengthPrefixed(writer, payload); err != nil {
+		t.Fatalf("writeLengthPrefixed returned error: %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("flush returned error: %v", err)
+	}
+
+	out := buf.Bytes()
+	if len(out) != 4+len(payload) {
+		t.Fatalf("expected %d bytes, got %d", 4+len(payload), len(out))
+	}
+
+	length := uint32(out[0])<<24 | uint32(out[1])<<16 | uint32(out[2])<<8 | uint32(out[3])
+	if int(length) != len(payload) {
+		t.Errorf("expected length prefix %d, got %d", len(payload), length)
+	}
+	if !bytes.Equal(out[4:], payload) {
+		t.Errorf("expected payload %q, got %q", payload, out[4:])
+	}
+}
+
+func TestWriteLengthPrefixedMultipleFrames(t *testing.T) {
+	var buf bytes.Buffer
+	writer := bufio.NewWriter(&buf)
+
+	frames := [][]byte{[]byte("first"), []byte(""), []byte("third frame")}
+	for _, frame := range frames {
+		if err := writeLengthPrefixed(writer, frame); err != nil {
+			t.Fatalf("writeLengthPrefixed returned error: %v", err)
+		}
+	}
+	writer.Flush()
+
+	remaining := buf.Bytes()
+	for _, frame := range frames {
+		if len(remaining) < 4 {
+			t.Fatalf("truncated length prefix, %d bytes left", len(remaining))
+		}
+		length := uint32(remaining[0])<<24 | uint32(remaining[1])<<16 | uint32(remaining[2])<<8 | uint32(remaining[3])
+		remaining = remaining[4:]
+		if int(length) != len(frame) {
+			t.Fatalf("expected length %d, got %d", len(frame), length)
+		}
+		if !bytes.Equal(remaining[:length], frame) {
+			t.Fatalf("expected frame %q, got %q", frame, remaining[:length])
+		}
+		remaining = remaining[length:]
+	}
+	if len(remaining) != 0 {
+		t.Errorf("expected no trailing bytes, got %d", len(remaining))
+	}
+}
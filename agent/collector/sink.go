@@ -0,0 +1,222 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+/*
+Constants
+*/
+const snapshotManifestFileName = "manifest.json"
+const writeManifestTemplate = "cat > %s"
+
+const (
+	UploadBackendNone  = ""
+	UploadBackendS3    = "s3"
+	UploadBackendGCS   = "gcs"
+	UploadBackendSwift = "swift"
+)
+
+/*
+Settings
+*/
+type UploadSettings struct {
+	Backend           string `yaml:"backend"`
+	Bucket            string `yaml:"bucket"`
+	Prefix            string `yaml:"prefix"`
+	CredentialsSource string `yaml:"credentials_source"`
+	KeepLocal         bool   `yaml:"keep_local"`
+}
+
+// snapshotManifest describes the blocks pushed to object storage for a single
+// snapshot, so a later restore can resume a partial upload or fetch blocks
+// individually instead of re-downloading the whole snapshot.
+type snapshotManifest struct {
+	Snapshot      string          `json:"snapshot"`
+	TimestampFrom int64           `json:"timestampFrom"`
+	TimestampTo   int64           `json:"timestampTo"`
+	Blocks        []blockMetadata `json:"blocks"`
+}
+
+// SnapshotSink uploads a lightened snapshot directory straight from the
+// remote host, without pulling it back over SSH first.
+type SnapshotSink interface {
+	// Name identifies the backend for logging.
+	Name() string
+
+	// Upload pushes every block under src to the backend and writes the
+	// manifest alongside them so the upload can be addressed and resumed
+	// block by block.
+	Upload(agent SSHCollectingAgent, src string, manifest snapshotManifest) error
+}
+
+// NewSnapshotSink builds the sink selected by settings.Backend, or nil
+// if uploading is disabled.
+func NewSnapshotSink(settings UploadSettings) (SnapshotSink, error) {
+	switch settings.Backend {
+	case UploadBackendNone:
+		return nil, nil
+	case UploadBackendS3:
+		return &s3Sink{settings: settings}, nil
+	case UploadBackendGCS:
+		return &gcsSink{settings: settings}, nil
+	case UploadBackendSwift:
+		return &swiftSink{settings: settings}, nil
+	default:
+		return nil, errors.New("unknown upload backend: " + settings.Backend)
+	}
+}
+
+// writeManifest drops the manifest JSON next to the uploaded blocks by
+// piping it through the same remote shell used for every other collector
+// operation, so sinks don't need their own transport.
+func writeManifest(agent SSHCollectingAgent, dest string, manifest snapshotManifest) error {
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return errors.New("Failed to marshal snapshot manifest (" + err.Error() + ")")
+	}
+
+	manifestPath := dest + "/" + snapshotManifestFileName
+	command := fmt.Sprintf(writeManifestTemplate, manifestPath)
+	_, serr, err := agent.ExecuteCommandWithInput(command, body)
+	if err != nil {
+		return err
+	}
+	if serr.Len() > 0 {
+		return errors.New("Failed to write snapshot manifest: " + serr.String())
+	}
+
+	return nil
+}
+
+/*
+S3
+*/
+type s3Sink struct {
+	settings UploadSettings
+}
+
+func (sink *s3Sink) Name() string {
+	return "s3"
+}
+
+// s3UploadTemplate uses the AWS CLI's multipart upload under the hood (the
+// default above 8MiB per part) and requests a CRC32 checksum per part so
+// corrupt transfers are caught instead of silently landing in the bucket.
+const s3UploadTemplate = "aws s3 cp --recursive --checksum-algorithm CRC32 --profile %s %s s3://%s/%s"
+const s3UploadTemplateNoProfile = "aws s3 cp --recursive --checksum-algorithm CRC32 %s s3://%s/%s"
+
+func (sink *s3Sink) Upload(agent SSHCollectingAgent, src string, manifest snapshotManifest) error {
+	// The manifest has to land in src *before* the recursive copy below, so
+	// it gets swept up in the same upload instead of being written (and,
+	// since collect() removes src right after Upload returns, immediately
+	// lost) after the bucket already has its final set of objects.
+	if err := writeManifest(agent, src, manifest); err != nil {
+		return err
+	}
+
+	dest := sink.settings.Prefix + "/" + manifest.Snapshot
+
+	var command string
+	if sink.settings.CredentialsSource != "" {
+		command = fmt.Sprintf(s3UploadTemplate, sink.settings.CredentialsSource, src, sink.settings.Bucket, dest)
+	} else {
+		command = fmt.Sprintf(s3UploadTemplateNoProfile, src, sink.settings.Bucket, dest)
+	}
+
+	_, serr, err := agent.ExecuteCommand(command)
+	if err != nil {
+		return err
+	}
+	if serr.Len() > 0 {
+		return errors.New("Failed to upload snapshot to S3: " + serr.String())
+	}
+
+	return nil
+}
+
+/*
+GCS
+*/
+type gcsSink struct {
+	settings UploadSettings
+}
+
+func (sink *gcsSink) Name() string {
+	return "gcs"
+}
+
+// gcsCompositeUploadThreshold lowers gsutil's parallel_composite_upload
+// threshold (normally 150MiB) so individual multi-GB TSDB chunk files are
+// actually split into components and uploaded as a composite object,
+// instead of only parallelizing across the many small files in -r cp.
+const gcsCompositeUploadThreshold = "8M"
+const gcsUploadTemplate = "gsutil -o 'GSUtil:parallel_composite_upload_threshold=%s' -m cp -r %s gs://%s/%s"
+
+func (sink *gcsSink) Upload(agent SSHCollectingAgent, src string, manifest snapshotManifest) error {
+	// See s3Sink.Upload: the manifest must be written into src before the
+	// recursive gsutil copy, or it never reaches the bucket at all.
+	if err := writeManifest(agent, src, manifest); err != nil {
+		return err
+	}
+
+	dest := sink.settings.Prefix + "/" + manifest.Snapshot
+	command := fmt.Sprintf(gcsUploadTemplate, gcsCompositeUploadThreshold, src, sink.settings.Bucket, dest)
+	if sink.settings.CredentialsSource != "" {
+		command = fmt.Sprintf("GOOGLE_APPLICATION_CREDENTIALS=%s %s", sink.settings.CredentialsSource, command)
+	}
+
+	_, serr, err := agent.ExecuteCommand(command)
+	if err != nil {
+		return err
+	}
+	if serr.Len() > 0 {
+		return errors.New("Failed to upload snapshot to GCS: " + serr.String())
+	}
+
+	return nil
+}
+
+/*
+Swift
+*/
+type swiftSink struct {
+	settings UploadSettings
+}
+
+func (sink *swiftSink) Name() string {
+	return "swift"
+}
+
+// --segment-size makes swift upload split anything over 1GiB into 1GiB
+// segments (tied together by a static large object via --use-slo) so a
+// multi-GB snapshot still round-trips in bounded-size objects.
+const swiftUploadTemplate = "swift upload --use-slo --segment-size 1073741824 %s %s --object-name %s"
+
+func (sink *swiftSink) Upload(agent SSHCollectingAgent, src string, manifest snapshotManifest) error {
+	// See s3Sink.Upload: the manifest must be written into src before
+	// `swift upload` walks it, or it never reaches the container.
+	if err := writeManifest(agent, src, manifest); err != nil {
+		return err
+	}
+
+	dest := sink.settings.Prefix + "/" + manifest.Snapshot
+	command := fmt.Sprintf(swiftUploadTemplate, sink.settings.Bucket, src, dest)
+	if sink.settings.CredentialsSource != "" {
+		// Swift's CLI takes its credentials from an OpenStack RC file
+		// sourced into the shell, not from a flag.
+		command = fmt.Sprintf(". %s && %s", sink.settings.CredentialsSource, command)
+	}
+
+	_, serr, err := agent.ExecuteCommand(command)
+	if err != nil {
+		return err
+	}
+	if serr.Len() > 0 {
+		return errors.New("Failed to upload snapshot to Swift: " + serr.String())
+	}
+
+	return nil
+}